@@ -8,6 +8,7 @@ import (
 	"fmt"
 
 	"github.com/hashicorp/consul/acl"
+	"github.com/hashicorp/consul/agent/consul/stream/filter"
 )
 
 // Topic is an identifier that partitions events. A subscription will only receive
@@ -37,6 +38,19 @@ type Payload interface {
 	HasReadPermission(authz acl.Authorizer) bool
 }
 
+// FilterablePayload is implemented by Payload types that support evaluation
+// of an arbitrary filter.Matcher, in addition to the key/namespace check in
+// FilterByKey. Payloads which do not implement this interface are never
+// matched by a subscription filter, other than framing events which are
+// always passed through.
+type FilterablePayload interface {
+	Payload
+
+	// ToFilterable returns the filter.Selectable view of the payload that a
+	// filter.Matcher is evaluated against.
+	ToFilterable() filter.Selectable
+}
+
 // PayloadEvents is an Payload which contains multiple Events.
 type PayloadEvents struct {
 	Items []Event
@@ -80,6 +94,47 @@ func (p *PayloadEvents) FilterByKey(key, namespace string) bool {
 	})
 }
 
+// MatchesFilter removes events from the payload which do not satisfy m. It
+// returns false if none of the events match, the same convention used by
+// FilterByKey. Framing events always match so that clients still see
+// end-of-snapshot and new-snapshot notifications.
+func (p *PayloadEvents) MatchesFilter(m filter.Matcher) bool {
+	return p.filter(func(event Event) bool {
+		if fe, ok := event.Payload.(framingPayload); ok {
+			return fe.isFramingEvent()
+		}
+		fp, ok := event.Payload.(FilterablePayload)
+		if !ok {
+			return false
+		}
+		return m.Evaluate(fp.ToFilterable())
+	})
+}
+
+// FilterForSubscription filters p down to the events a subscriber with req
+// and authz should receive: the existing key/namespace check, then the ACL
+// read-permission check, and finally, if req.Filter is non-empty, its
+// compiled req.Matcher(). The matcher is only consulted when a filter was
+// actually requested — req.Matcher() is non-nil even for an empty filter,
+// evaluating to "matches everything", but MatchesFilter drops any event
+// whose payload doesn't implement FilterablePayload, which would otherwise
+// silently suppress ordinary payloads from unfiltered subscriptions. The
+// ACL check always runs before the filter expression is evaluated, so a
+// filter can never be used to infer whether access would otherwise have
+// been denied. Framing events satisfy all three checks unconditionally.
+func (p *PayloadEvents) FilterForSubscription(req SubscribeRequest, authz acl.Authorizer) bool {
+	if !p.FilterByKey(req.Key, req.Namespace) {
+		return false
+	}
+	if !p.HasReadPermission(authz) {
+		return false
+	}
+	if req.Filter != "" {
+		return p.MatchesFilter(req.Matcher())
+	}
+	return true
+}
+
 func (p *PayloadEvents) Len() int {
 	return len(p.Items)
 }
@@ -114,32 +169,23 @@ func (framingEvent) HasReadPermission(acl.Authorizer) bool {
 	return true
 }
 
-type endOfSnapshot struct {
-	framingEvent
-}
-
-type newSnapshotToFollow struct {
-	framingEvent
+// framingPayload identifies payloads that must always pass a subscription
+// filter, regardless of what the filter expression checks.
+type framingPayload interface {
+	isFramingEvent() bool
 }
 
-type closeSubscriptionPayload struct {
-	tokensSecretIDs []string
+func (framingEvent) isFramingEvent() bool {
+	return true
 }
 
-func (closeSubscriptionPayload) FilterByKey(string, string) bool {
-	return false
+type endOfSnapshot struct {
+	framingEvent
 }
 
-func (closeSubscriptionPayload) HasReadPermission(acl.Authorizer) bool {
-	return false
+type newSnapshotToFollow struct {
+	framingEvent
 }
 
-// NewCloseSubscriptionEvent returns a special Event that is handled by the
-// stream package, and is never sent to subscribers. EventProcessor handles
-// these events, and closes any subscriptions which were created using a token
-// which matches any of the tokenSecretIDs.
-//
-// tokenSecretIDs may contain duplicate IDs.
-func NewCloseSubscriptionEvent(tokenSecretIDs []string) Event {
-	return Event{Payload: closeSubscriptionPayload{tokensSecretIDs: tokenSecretIDs}}
-}
+// closeSubscriptionPayload and NewCloseSubscriptionEvent are defined in
+// subscription_close.go.
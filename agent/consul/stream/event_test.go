@@ -0,0 +1,197 @@
+package stream
+
+import (
+	"testing"
+
+	"github.com/hashicorp/consul/acl"
+	"github.com/hashicorp/consul/agent/consul/stream/filter"
+)
+
+type testFilterablePayload struct {
+	fields map[string]interface{}
+}
+
+func (p testFilterablePayload) FilterByKey(string, string) bool { return true }
+
+func (p testFilterablePayload) HasReadPermission(acl.Authorizer) bool { return true }
+
+func (p testFilterablePayload) ToFilterable() filter.Selectable {
+	return fakeSelectable(p.fields)
+}
+
+// testPlainPayload is an ordinary Payload that does not implement
+// FilterablePayload, e.g. one whose topic doesn't support filter
+// expressions yet.
+type testPlainPayload struct{}
+
+func (testPlainPayload) FilterByKey(string, string) bool { return true }
+
+func (testPlainPayload) HasReadPermission(acl.Authorizer) bool { return true }
+
+type fakeSelectable map[string]interface{}
+
+func (f fakeSelectable) SelectorValue(selector string) (interface{}, bool) {
+	v, ok := f[selector]
+	return v, ok
+}
+
+// testACLPayload behaves like testFilterablePayload but lets a test control
+// the outcome of the ACL check independently of the filter expression.
+type testACLPayload struct {
+	testFilterablePayload
+	allowed bool
+}
+
+func (p testACLPayload) HasReadPermission(acl.Authorizer) bool { return p.allowed }
+
+func TestPayloadEvents_MatchesFilter(t *testing.T) {
+	m, err := filter.Parse(`Meta.env == "prod"`)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	events := NewPayloadEvents(
+		Event{Payload: testFilterablePayload{fields: map[string]interface{}{"Meta.env": "prod"}}},
+		Event{Payload: testFilterablePayload{fields: map[string]interface{}{"Meta.env": "staging"}}},
+		Event{Payload: endOfSnapshot{}},
+	)
+
+	if !events.MatchesFilter(m) {
+		t.Fatal("expected at least one match")
+	}
+	if got := events.Len(); got != 2 {
+		t.Fatalf("expected end-of-snapshot and one matching event to remain, got %d", got)
+	}
+}
+
+func TestPayloadEvents_MatchesFilter_NoMatches(t *testing.T) {
+	m, err := filter.Parse(`Meta.env == "prod"`)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	events := NewPayloadEvents(
+		Event{Payload: testFilterablePayload{fields: map[string]interface{}{"Meta.env": "staging"}}},
+	)
+
+	if events.MatchesFilter(m) {
+		t.Fatal("expected no matches")
+	}
+}
+
+func TestNewSubscribeRequest_InvalidFilter(t *testing.T) {
+	_, err := NewSubscribeRequest(SubscribeRequest{Filter: "not a valid expression"})
+	if err == nil {
+		t.Fatal("expected error")
+	}
+}
+
+func TestPayloadEvents_FilterForSubscription(t *testing.T) {
+	req, err := NewSubscribeRequest(SubscribeRequest{Key: "node-1", Filter: `Meta.env == "prod"`})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	events := NewPayloadEvents(
+		Event{Payload: testFilterablePayload{fields: map[string]interface{}{"Meta.env": "prod"}}},
+		Event{Payload: testFilterablePayload{fields: map[string]interface{}{"Meta.env": "staging"}}},
+	)
+
+	if !events.FilterForSubscription(req, nil) {
+		t.Fatal("expected at least one event to survive the key, ACL, and filter checks")
+	}
+	if got := events.Len(); got != 1 {
+		t.Fatalf("expected only the event matching the filter to remain, got %d", got)
+	}
+}
+
+func TestPayloadEvents_FilterForSubscription_ACLChecksRunsRegardlessOfFilter(t *testing.T) {
+	req, err := NewSubscribeRequest(SubscribeRequest{Filter: `Meta.env == "prod"`})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	// The event matches the filter expression but is denied by ACLs; the ACL
+	// check must still take effect and the event must not be delivered.
+	events := NewPayloadEvents(Event{Payload: testACLPayload{
+		testFilterablePayload: testFilterablePayload{fields: map[string]interface{}{"Meta.env": "prod"}},
+		allowed:               false,
+	}})
+
+	if events.FilterForSubscription(req, nil) {
+		t.Fatal("expected the ACL check to deny the event even though the filter matches")
+	}
+}
+
+func TestPayloadEvents_FilterForSubscription_NoFilter(t *testing.T) {
+	req, err := NewSubscribeRequest(SubscribeRequest{})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	events := NewPayloadEvents(
+		Event{Payload: testFilterablePayload{fields: map[string]interface{}{"Meta.env": "staging"}}},
+	)
+
+	if !events.FilterForSubscription(req, nil) {
+		t.Fatal("expected an unfiltered subscription to receive every event that passes key and ACL checks")
+	}
+}
+
+func TestPayloadEvents_FilterForSubscription_NoFilterNonFilterablePayload(t *testing.T) {
+	// An unfiltered subscription must not suppress payloads that don't
+	// implement FilterablePayload: req.Matcher() is non-nil even when no
+	// filter was requested, so FilterForSubscription must gate on
+	// req.Filter rather than req.Matcher() to avoid running the payload
+	// through MatchesFilter at all.
+	req, err := NewSubscribeRequest(SubscribeRequest{})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	events := NewPayloadEvents(Event{Payload: testPlainPayload{}})
+
+	if !events.FilterForSubscription(req, nil) {
+		t.Fatal("expected an unfiltered subscription to receive a non-FilterablePayload event")
+	}
+	if got := events.Len(); got != 1 {
+		t.Fatalf("expected the event to survive, got Len()=%d", got)
+	}
+}
+
+func TestPayloadEvents_FilterForSubscription_SnapshotReplay(t *testing.T) {
+	req, err := NewSubscribeRequest(SubscribeRequest{Filter: `Meta.env == "prod"`})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	// A snapshot replay is framed by new-snapshot/end-of-snapshot events,
+	// which must survive the filter alongside whichever live events match
+	// it, across the whole replay.
+	events := NewPayloadEvents(
+		Event{Payload: newSnapshotToFollow{}},
+		Event{Payload: testFilterablePayload{fields: map[string]interface{}{"Meta.env": "prod"}}},
+		Event{Payload: testFilterablePayload{fields: map[string]interface{}{"Meta.env": "staging"}}},
+		Event{Payload: endOfSnapshot{}},
+	)
+
+	if !events.FilterForSubscription(req, nil) {
+		t.Fatal("expected the framing events and the matching event to survive")
+	}
+	if got := events.Len(); got != 3 {
+		t.Fatalf("expected new-snapshot, the matching event, and end-of-snapshot to remain, got %d", got)
+	}
+}
+
+func TestNewSubscribeRequest_ReusesMatcher(t *testing.T) {
+	req, err := NewSubscribeRequest(SubscribeRequest{Filter: `Meta.env == "prod"`})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if req.Matcher() == nil {
+		t.Fatal("expected a compiled matcher")
+	}
+	if req.Matcher() != req.Matcher() {
+		t.Fatal("expected the same compiled matcher to be returned on every call")
+	}
+}
@@ -0,0 +1,163 @@
+// Package filter implements a small expression language for matching
+// streamed events against a subscriber-supplied predicate, for example:
+//
+//	Tags contains "canary" and Meta.env == "prod"
+//
+// It intentionally covers a narrow subset of what a general purpose
+// expression library like go-bexpr supports: a flat conjunction of simple
+// comparisons against dotted field selectors. Events are cheap to produce
+// and expensive to re-evaluate per-subscriber, so Parse is meant to run
+// once per subscription and the returned Matcher reused for every event.
+package filter
+
+import (
+	"fmt"
+	"strings"
+)
+
+// Selectable is implemented by values that can be evaluated against a
+// Matcher. Selector paths are dotted field names, e.g. "Meta.env".
+type Selectable interface {
+	// SelectorValue returns the value addressed by selector, and false if
+	// the selector does not resolve to anything on this value.
+	SelectorValue(selector string) (interface{}, bool)
+}
+
+// Matcher evaluates a compiled filter expression against a Selectable.
+type Matcher interface {
+	// Evaluate returns true if data satisfies the filter expression.
+	Evaluate(data Selectable) bool
+}
+
+// Op is a comparison operator supported by the expression language.
+type Op string
+
+const (
+	OpEqual    Op = "=="
+	OpNotEqual Op = "!="
+	OpContains Op = "contains"
+)
+
+// clause is a single "selector op value" comparison.
+type clause struct {
+	selector string
+	op       Op
+	value    string
+}
+
+func (c clause) Evaluate(data Selectable) bool {
+	got, ok := data.SelectorValue(c.selector)
+	if !ok {
+		return false
+	}
+
+	switch c.op {
+	case OpEqual:
+		return toString(got) == c.value
+	case OpNotEqual:
+		return toString(got) != c.value
+	case OpContains:
+		return containsValue(got, c.value)
+	default:
+		return false
+	}
+}
+
+// expression is a conjunction of clauses. The language only supports "and",
+// there is no support for "or" or parenthesized grouping - subscribers that
+// need either should compose multiple subscriptions instead.
+type expression struct {
+	clauses []clause
+}
+
+func (e *expression) Evaluate(data Selectable) bool {
+	for _, c := range e.clauses {
+		if !c.Evaluate(data) {
+			return false
+		}
+	}
+	return true
+}
+
+// Parse compiles expr into a Matcher. An empty expr matches everything.
+func Parse(expr string) (Matcher, error) {
+	expr = strings.TrimSpace(expr)
+	if expr == "" {
+		return matchAll{}, nil
+	}
+
+	parts := strings.Split(expr, " and ")
+	clauses := make([]clause, 0, len(parts))
+	for _, part := range parts {
+		c, err := parseClause(strings.TrimSpace(part))
+		if err != nil {
+			return nil, fmt.Errorf("invalid filter expression %q: %w", expr, err)
+		}
+		clauses = append(clauses, c)
+	}
+	return &expression{clauses: clauses}, nil
+}
+
+func parseClause(part string) (clause, error) {
+	for _, op := range []Op{OpEqual, OpNotEqual, OpContains} {
+		sep := " " + string(op) + " "
+		if op == OpEqual || op == OpNotEqual {
+			sep = string(op)
+		}
+
+		idx := strings.Index(part, sep)
+		if idx < 0 {
+			continue
+		}
+
+		selector := strings.TrimSpace(part[:idx])
+		value := strings.TrimSpace(part[idx+len(sep):])
+		value = unquote(value)
+
+		if selector == "" || value == "" {
+			return clause{}, fmt.Errorf("clause %q is missing a selector or value", part)
+		}
+		return clause{selector: selector, op: op, value: value}, nil
+	}
+
+	return clause{}, fmt.Errorf("clause %q does not contain a supported operator", part)
+}
+
+func unquote(value string) string {
+	if len(value) >= 2 && value[0] == '"' && value[len(value)-1] == '"' {
+		return value[1 : len(value)-1]
+	}
+	return value
+}
+
+func toString(v interface{}) string {
+	switch t := v.(type) {
+	case string:
+		return t
+	case fmt.Stringer:
+		return t.String()
+	default:
+		return fmt.Sprintf("%v", t)
+	}
+}
+
+func containsValue(haystack interface{}, needle string) bool {
+	switch t := haystack.(type) {
+	case []string:
+		for _, s := range t {
+			if s == needle {
+				return true
+			}
+		}
+		return false
+	case string:
+		return strings.Contains(t, needle)
+	default:
+		return false
+	}
+}
+
+// matchAll is the Matcher used for an empty filter expression.
+type matchAll struct{}
+
+func (matchAll) Evaluate(Selectable) bool { return true }
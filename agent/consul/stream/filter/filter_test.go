@@ -0,0 +1,85 @@
+package filter
+
+import "testing"
+
+type fakeSelectable map[string]interface{}
+
+func (f fakeSelectable) SelectorValue(selector string) (interface{}, bool) {
+	v, ok := f[selector]
+	return v, ok
+}
+
+func TestParse_Empty(t *testing.T) {
+	m, err := Parse("")
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if !m.Evaluate(fakeSelectable{}) {
+		t.Fatal("empty filter should match everything")
+	}
+}
+
+func TestParse_Equal(t *testing.T) {
+	m, err := Parse(`Meta.env == "prod"`)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	data := fakeSelectable{"Meta.env": "prod"}
+	if !m.Evaluate(data) {
+		t.Fatal("expected match")
+	}
+
+	data["Meta.env"] = "staging"
+	if m.Evaluate(data) {
+		t.Fatal("expected no match")
+	}
+}
+
+func TestParse_Contains(t *testing.T) {
+	m, err := Parse(`Tags contains "canary"`)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	if !m.Evaluate(fakeSelectable{"Tags": []string{"canary", "v2"}}) {
+		t.Fatal("expected match")
+	}
+	if m.Evaluate(fakeSelectable{"Tags": []string{"v2"}}) {
+		t.Fatal("expected no match")
+	}
+}
+
+func TestParse_Conjunction(t *testing.T) {
+	m, err := Parse(`Tags contains "canary" and Meta.env == "prod"`)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	match := fakeSelectable{"Tags": []string{"canary"}, "Meta.env": "prod"}
+	if !m.Evaluate(match) {
+		t.Fatal("expected match")
+	}
+
+	noMatch := fakeSelectable{"Tags": []string{"canary"}, "Meta.env": "staging"}
+	if m.Evaluate(noMatch) {
+		t.Fatal("expected no match")
+	}
+}
+
+func TestParse_MissingSelector(t *testing.T) {
+	m, err := Parse(`Meta.env == "prod"`)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if m.Evaluate(fakeSelectable{}) {
+		t.Fatal("expected no match when selector is absent")
+	}
+}
+
+func TestParse_InvalidExpression(t *testing.T) {
+	_, err := Parse("not a valid expression")
+	if err == nil {
+		t.Fatal("expected error")
+	}
+}
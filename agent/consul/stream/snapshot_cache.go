@@ -0,0 +1,215 @@
+package stream
+
+import (
+	"container/list"
+	"sync"
+	"time"
+
+	"github.com/armon/go-metrics"
+)
+
+// SnapshotFunc materializes a snapshot of a topic's state as of the moment
+// it's called. SnapshotCache calls the SnapshotFunc passed to Acquire at
+// most once per cached (topic, key) pair, even when multiple goroutines
+// race to materialize the same key; the result is shared by every
+// subscriber that asks for the same snapshot while it remains cached.
+type SnapshotFunc func() (interface{}, error)
+
+// SnapshotCacheConfig bounds the memory a SnapshotCache can hold on behalf
+// of subscriptions (see NewSubscription). Without a bound, a burst of slow
+// subscribers across many distinct (topic, key) pairs can pin an unbounded
+// number of snapshots in memory for as long as any one of them stays
+// subscribed.
+type SnapshotCacheConfig struct {
+	// MaxEntries is the maximum number of distinct snapshots the cache will
+	// hold at once. When a new snapshot would exceed the limit, the least
+	// recently used entry with no active subscribers is evicted first. A
+	// value <= 0 disables the bound.
+	MaxEntries int
+
+	// TTL is how long a snapshot with no active subscribers is kept before
+	// being evicted. A value <= 0 disables TTL-based eviction.
+	TTL time.Duration
+}
+
+// snapshotCacheEntry is the value stored in the LRU list. Only successful
+// materializations are ever stored; a SnapshotFunc that returns an error is
+// not cached, so the next Acquire for the same key retries it.
+type snapshotCacheEntry struct {
+	key      string
+	value    interface{}
+	refCount int
+	idleAt   time.Time
+}
+
+// SnapshotCache is a bounded, LRU cache of materialized snapshots, keyed by
+// topic and key, shared across every subscriber that requests the same
+// snapshot. Subscribers that Acquire a cached snapshot after it has been
+// evicted cause it to be re-materialized via SnapshotFunc.
+type SnapshotCache struct {
+	cfg SnapshotCacheConfig
+
+	mu       sync.Mutex
+	entries  map[string]*list.Element // key -> element in lru, value *snapshotCacheEntry
+	lru      *list.List               // front = most recently used
+	inflight map[string]*inflightCall // key -> materialization in progress for a cold key
+}
+
+// inflightCall coordinates goroutines that call Acquire for the same cold
+// key concurrently, so only one of them runs SnapshotFunc. waiters counts
+// every caller joined before done is closed, including the one running fn;
+// on success the cached entry's refCount is seeded with that count so every
+// joined caller gets exactly one release. value and err carry fn's result
+// directly to joiners when it fails, since a failed materialization is
+// never cached.
+type inflightCall struct {
+	done    chan struct{}
+	waiters int
+	value   interface{}
+	err     error
+}
+
+// NewSnapshotCache returns a SnapshotCache configured with cfg.
+func NewSnapshotCache(cfg SnapshotCacheConfig) *SnapshotCache {
+	return &SnapshotCache{
+		cfg:      cfg,
+		entries:  make(map[string]*list.Element),
+		lru:      list.New(),
+		inflight: make(map[string]*inflightCall),
+	}
+}
+
+// Acquire returns the cached snapshot for key, calling fn to materialize it
+// on a cache miss. If another goroutine is already materializing key, this
+// call waits for that result instead of calling fn itself. A failed
+// materialization (fn returning a non-nil error) is not cached, so the next
+// Acquire for key retries fn rather than returning the same error forever.
+// The caller must call the returned release func exactly once, when it no
+// longer needs the snapshot, so the cache can evict it; release is a no-op
+// if Acquire returned an error.
+func (c *SnapshotCache) Acquire(key string, fn SnapshotFunc) (interface{}, func(), error) {
+	c.mu.Lock()
+
+	if elem, ok := c.entries[key]; ok {
+		entry := elem.Value.(*snapshotCacheEntry)
+		entry.refCount++
+		c.lru.MoveToFront(elem)
+		c.mu.Unlock()
+
+		metrics.IncrCounter([]string{"stream", "snapshot_cache", "hit"}, 1)
+		return entry.value, c.releaseFunc(key), nil
+	}
+
+	if call, ok := c.inflight[key]; ok {
+		call.waiters++
+		c.mu.Unlock()
+
+		<-call.done
+
+		c.mu.Lock()
+		elem, ok := c.entries[key]
+		c.mu.Unlock()
+		if !ok {
+			return call.value, func() {}, call.err
+		}
+
+		metrics.IncrCounter([]string{"stream", "snapshot_cache", "hit"}, 1)
+		entry := elem.Value.(*snapshotCacheEntry)
+		return entry.value, c.releaseFunc(key), nil
+	}
+
+	call := &inflightCall{done: make(chan struct{}), waiters: 1}
+	c.inflight[key] = call
+	c.mu.Unlock()
+
+	value, err := fn()
+
+	c.mu.Lock()
+	delete(c.inflight, key)
+	call.value, call.err = value, err
+
+	if err == nil {
+		entry := &snapshotCacheEntry{key: key, value: value, refCount: call.waiters}
+		elem := c.lru.PushFront(entry)
+		c.entries[key] = elem
+		metrics.IncrCounter([]string{"stream", "snapshot_cache", "miss"}, 1)
+		c.evictLocked()
+	}
+	close(call.done)
+	c.mu.Unlock()
+
+	if err != nil {
+		return value, func() {}, err
+	}
+	return value, c.releaseFunc(key), nil
+}
+
+func (c *SnapshotCache) releaseFunc(key string) func() {
+	var once sync.Once
+	return func() {
+		once.Do(func() { c.release(key) })
+	}
+}
+
+func (c *SnapshotCache) release(key string) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	elem, ok := c.entries[key]
+	if !ok {
+		return
+	}
+	entry := elem.Value.(*snapshotCacheEntry)
+	entry.refCount--
+	if entry.refCount <= 0 {
+		entry.refCount = 0
+		entry.idleAt = now()
+	}
+	c.evictLocked()
+}
+
+// evictLocked removes idle entries once they have exceeded the configured
+// TTL, and then removes the least recently used idle entries until the
+// cache is back within MaxEntries. c.mu must be held.
+func (c *SnapshotCache) evictLocked() {
+	if c.cfg.TTL > 0 {
+		for elem := c.lru.Back(); elem != nil; {
+			entry := elem.Value.(*snapshotCacheEntry)
+			prev := elem.Prev()
+			if entry.refCount == 0 && now().Sub(entry.idleAt) >= c.cfg.TTL {
+				c.removeLocked(elem)
+			}
+			elem = prev
+		}
+	}
+
+	if c.cfg.MaxEntries <= 0 {
+		return
+	}
+	for elem := c.lru.Back(); len(c.entries) > c.cfg.MaxEntries && elem != nil; {
+		entry := elem.Value.(*snapshotCacheEntry)
+		prev := elem.Prev()
+		if entry.refCount == 0 {
+			c.removeLocked(elem)
+		}
+		elem = prev
+	}
+}
+
+func (c *SnapshotCache) removeLocked(elem *list.Element) {
+	entry := elem.Value.(*snapshotCacheEntry)
+	delete(c.entries, entry.key)
+	c.lru.Remove(elem)
+	metrics.IncrCounter([]string{"stream", "snapshot_cache", "evicted"}, 1)
+}
+
+// Len returns the number of snapshots currently cached, including ones with
+// active subscribers. It is intended for tests and metrics.
+func (c *SnapshotCache) Len() int {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return len(c.entries)
+}
+
+// now is a var so tests can simulate TTL expiry without sleeping.
+var now = time.Now
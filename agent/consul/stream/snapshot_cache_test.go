@@ -0,0 +1,167 @@
+package stream
+
+import (
+	"errors"
+	"fmt"
+	"sync"
+	"testing"
+	"time"
+)
+
+func TestSnapshotCache_HitsAndMisses(t *testing.T) {
+	c := NewSnapshotCache(SnapshotCacheConfig{})
+
+	var calls int
+	fn := func() (interface{}, error) {
+		calls++
+		return "snapshot", nil
+	}
+
+	v1, release1, err := c.Acquire("topic/key", fn)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if v1 != "snapshot" {
+		t.Fatalf("unexpected value: %v", v1)
+	}
+
+	v2, release2, err := c.Acquire("topic/key", fn)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if v2 != "snapshot" {
+		t.Fatalf("unexpected value: %v", v2)
+	}
+
+	if calls != 1 {
+		t.Fatalf("expected fn to be called once, got %d", calls)
+	}
+
+	release1()
+	release2()
+}
+
+func TestSnapshotCache_RetriesAfterFailedAcquire(t *testing.T) {
+	c := NewSnapshotCache(SnapshotCacheConfig{})
+
+	wantErr := errors.New("transient failure")
+	var calls int
+	fn := func() (interface{}, error) {
+		calls++
+		if calls == 1 {
+			return nil, wantErr
+		}
+		return "snapshot", nil
+	}
+
+	_, release1, err := c.Acquire("topic/key", fn)
+	if !errors.Is(err, wantErr) {
+		t.Fatalf("expected %v, got %v", wantErr, err)
+	}
+	release1()
+
+	if got := c.Len(); got != 0 {
+		t.Fatalf("expected a failed materialization not to be cached, got Len()=%d", got)
+	}
+
+	v2, release2, err := c.Acquire("topic/key", fn)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	defer release2()
+
+	if v2 != "snapshot" {
+		t.Fatalf("unexpected value: %v", v2)
+	}
+	if calls != 2 {
+		t.Fatalf("expected fn to be retried after the first failure, got %d calls", calls)
+	}
+}
+
+func TestSnapshotCache_EvictsIdleEntriesPastTTL(t *testing.T) {
+	realNow := now
+	defer func() { now = realNow }()
+
+	fakeNow := time.Unix(0, 0)
+	now = func() time.Time { return fakeNow }
+
+	c := NewSnapshotCache(SnapshotCacheConfig{TTL: time.Minute})
+	fn := func() (interface{}, error) { return "snapshot", nil }
+
+	_, release, err := c.Acquire("topic/key", fn)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	release()
+
+	if got := c.Len(); got != 1 {
+		t.Fatalf("expected entry to remain cached while within TTL, got Len()=%d", got)
+	}
+
+	fakeNow = fakeNow.Add(2 * time.Minute)
+
+	// Acquiring a different key triggers the eviction sweep.
+	_, release2, err := c.Acquire("topic/other", fn)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	defer release2()
+
+	if got := c.Len(); got != 1 {
+		t.Fatalf("expected idle entry past TTL to be evicted, got Len()=%d", got)
+	}
+}
+
+func TestSnapshotCache_EvictsLRUWhenOverMaxEntries(t *testing.T) {
+	c := NewSnapshotCache(SnapshotCacheConfig{MaxEntries: 2})
+	fn := func() (interface{}, error) { return "snapshot", nil }
+
+	_, release1, _ := c.Acquire("a", fn)
+	_, release2, _ := c.Acquire("b", fn)
+	release1()
+	release2()
+
+	// Both "a" and "b" are idle; acquiring "c" should evict the LRU one ("a").
+	_, release3, _ := c.Acquire("c", fn)
+	defer release3()
+
+	if got := c.Len(); got != 2 {
+		t.Fatalf("expected cache to stay within MaxEntries, got Len()=%d", got)
+	}
+
+	var calls int
+	countingFn := func() (interface{}, error) {
+		calls++
+		return "snapshot", nil
+	}
+	_, release4, _ := c.Acquire("a", countingFn)
+	defer release4()
+	if calls != 1 {
+		t.Fatal("expected evicted key \"a\" to be re-materialized on next Acquire")
+	}
+}
+
+func TestSnapshotCache_ConcurrentAcquireAndRelease(t *testing.T) {
+	c := NewSnapshotCache(SnapshotCacheConfig{MaxEntries: 4, TTL: time.Millisecond})
+	fn := func() (interface{}, error) { return "snapshot", nil }
+
+	var wg sync.WaitGroup
+	for i := 0; i < 50; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			key := fmt.Sprintf("topic/%d", i%8)
+			_, release, err := c.Acquire(key, fn)
+			if err != nil {
+				t.Errorf("unexpected error: %v", err)
+				return
+			}
+			release()
+		}(i)
+	}
+	wg.Wait()
+
+	if got := c.Len(); got > c.cfg.MaxEntries {
+		t.Fatalf("expected cache to stay within MaxEntries=%d, got Len()=%d", c.cfg.MaxEntries, got)
+	}
+}
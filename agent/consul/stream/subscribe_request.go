@@ -0,0 +1,45 @@
+package stream
+
+import (
+	"fmt"
+
+	"github.com/hashicorp/consul/agent/consul/stream/filter"
+)
+
+// SubscribeRequest identifies the subset of the event stream on a Topic that
+// a subscriber wants to receive.
+type SubscribeRequest struct {
+	Topic     Topic
+	Key       string
+	Namespace string
+	Token     string
+
+	// Filter is an optional, unparsed filter expression in the language
+	// implemented by the filter package, e.g.
+	// `Tags contains "canary" and Meta.env == "prod"`. It is compiled once
+	// by NewSubscribeRequest and the resulting matcher is evaluated against
+	// every event considered for delivery to this subscription.
+	Filter string
+
+	matcher filter.Matcher
+}
+
+// NewSubscribeRequest validates req.Filter and compiles it into a
+// filter.Matcher, returning an error if the expression is invalid. The ACL
+// check for the request is performed separately by the caller, before
+// events are ever filtered, so that an invalid filter never leaks whether a
+// key it references exists.
+func NewSubscribeRequest(req SubscribeRequest) (SubscribeRequest, error) {
+	m, err := filter.Parse(req.Filter)
+	if err != nil {
+		return SubscribeRequest{}, fmt.Errorf("invalid subscription filter: %w", err)
+	}
+	req.matcher = m
+	return req, nil
+}
+
+// Matcher returns the filter.Matcher compiled from Filter. It is only valid
+// on a SubscribeRequest returned from NewSubscribeRequest.
+func (r SubscribeRequest) Matcher() filter.Matcher {
+	return r.matcher
+}
@@ -0,0 +1,50 @@
+package stream
+
+// Snapshotter materializes the current state for the topic and key
+// identified by req as a *PayloadEvents. It is the per-topic analogue of
+// SnapshotFunc: passed to NewSubscription, and invoked through a
+// SnapshotCache so concurrent subscribers to the same (topic, key) pair
+// share one materialization.
+type Snapshotter func(req SubscribeRequest) (*PayloadEvents, error)
+
+// Subscription is a subscriber's view of a topic, scoped by req and backed
+// by a snapshot acquired from a SnapshotCache. It is the thing that
+// actually holds a reference to a cached snapshot on behalf of a
+// subscriber, so the cache's bound reflects real subscriber memory rather
+// than an unused accounting structure.
+type Subscription struct {
+	req     SubscribeRequest
+	release func()
+}
+
+// NewSubscription acquires the snapshot for req's topic and key from cache,
+// materializing it with snap on a cache miss. The returned *PayloadEvents is
+// a copy the caller owns exclusively: it is safe to filter in place, even
+// though its snapshot may be shared with other subscriptions. The caller
+// must call Close when the subscription ends so the cache can evict the
+// snapshot once no subscription still references it.
+func NewSubscription(req SubscribeRequest, cache *SnapshotCache, snap Snapshotter) (*Subscription, *PayloadEvents, error) {
+	value, release, err := cache.Acquire(snapshotCacheKey(req.Topic, req.Key), func() (interface{}, error) {
+		return snap(req)
+	})
+	if err != nil {
+		release()
+		return nil, nil, err
+	}
+
+	cached := value.(*PayloadEvents)
+	events := NewPayloadEvents(append([]Event(nil), cached.Items...)...)
+
+	return &Subscription{req: req, release: release}, events, nil
+}
+
+// Close releases this subscription's reference on its cached snapshot,
+// allowing the cache to evict it once no other subscription holds it.
+func (s *Subscription) Close() {
+	s.release()
+}
+
+// snapshotCacheKey derives the SnapshotCache key for a (topic, key) pair.
+func snapshotCacheKey(topic Topic, key string) string {
+	return topic.String() + "/" + key
+}
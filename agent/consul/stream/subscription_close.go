@@ -0,0 +1,118 @@
+package stream
+
+import "github.com/hashicorp/consul/acl"
+
+// SubscriptionDescriptor identifies the ACL context a subscription was
+// created with. closeSubscriptionPayload.matchesSubscription takes one to
+// decide whether the close event applies to that subscription.
+type SubscriptionDescriptor struct {
+	TokenSecretID string
+	PolicyIDs     []string
+	RoleIDs       []string
+	Partition     string
+	Namespace     string
+}
+
+// CloseSubscriptionRequest identifies the subscriptions that
+// NewCloseSubscriptionEvent should close. A subscription is closed if any
+// one of its token, policy IDs, role IDs, partition, or namespace
+// intersects with the corresponding field below. Unset fields never match.
+type CloseSubscriptionRequest struct {
+	TokenSecretIDs []string
+	PolicyIDs      []string
+	RoleIDs        []string
+	Partitions     []string
+	Namespaces     []string
+}
+
+type stringSet map[string]struct{}
+
+func newStringSet(items []string) stringSet {
+	if len(items) == 0 {
+		return nil
+	}
+	set := make(stringSet, len(items))
+	for _, item := range items {
+		set[item] = struct{}{}
+	}
+	return set
+}
+
+func (s stringSet) contains(item string) bool {
+	_, ok := s[item]
+	return ok
+}
+
+func (s stringSet) containsAny(items []string) bool {
+	for _, item := range items {
+		if s.contains(item) {
+			return true
+		}
+	}
+	return false
+}
+
+type closeSubscriptionPayload struct {
+	tokensSecretIDs stringSet
+	policyIDs       stringSet
+	roleIDs         stringSet
+	partitions      stringSet
+	namespaces      stringSet
+}
+
+func (closeSubscriptionPayload) FilterByKey(string, string) bool {
+	return false
+}
+
+func (closeSubscriptionPayload) HasReadPermission(acl.Authorizer) bool {
+	return false
+}
+
+// matchesSubscription returns true if sub should be closed because it
+// intersects with p on any dimension: token, policy, role, partition, or
+// namespace.
+func (p closeSubscriptionPayload) matchesSubscription(sub SubscriptionDescriptor) bool {
+	switch {
+	case p.tokensSecretIDs.contains(sub.TokenSecretID):
+		return true
+	case p.partitions.contains(sub.Partition):
+		return true
+	case p.namespaces.contains(sub.Namespace):
+		return true
+	case p.policyIDs.containsAny(sub.PolicyIDs):
+		return true
+	case p.roleIDs.containsAny(sub.RoleIDs):
+		return true
+	default:
+		return false
+	}
+}
+
+// NewCloseSubscriptionEvent returns a special Event that is handled by the
+// stream package, and is never sent to subscribers. Its payload's
+// matchesSubscription reports true for any subscription whose
+// SubscriptionDescriptor intersects with req on any dimension (token,
+// policy, role, partition, or namespace), so a single event can describe,
+// for example, every subscription under a deleted partition or created with
+// a deleted ACL policy, without enumerating every affected token. No code in
+// this package calls matchesSubscription or closes subscriptions itself.
+//
+// Each field of req may contain duplicate IDs.
+func NewCloseSubscriptionEvent(req CloseSubscriptionRequest) Event {
+	return Event{Payload: closeSubscriptionPayload{
+		tokensSecretIDs: newStringSet(req.TokenSecretIDs),
+		policyIDs:       newStringSet(req.PolicyIDs),
+		roleIDs:         newStringSet(req.RoleIDs),
+		partitions:      newStringSet(req.Partitions),
+		namespaces:      newStringSet(req.Namespaces),
+	}}
+}
+
+// NewCloseSubscriptionEventByToken is a compatibility shim for callers
+// built against NewCloseSubscriptionEvent's earlier, token-only signature.
+//
+// Deprecated: construct a CloseSubscriptionRequest and call
+// NewCloseSubscriptionEvent directly.
+func NewCloseSubscriptionEventByToken(tokenSecretIDs []string) Event {
+	return NewCloseSubscriptionEvent(CloseSubscriptionRequest{TokenSecretIDs: tokenSecretIDs})
+}
@@ -0,0 +1,54 @@
+package stream
+
+import "testing"
+
+func TestCloseSubscriptionPayload_MatchesSubscription(t *testing.T) {
+	event := NewCloseSubscriptionEvent(CloseSubscriptionRequest{
+		TokenSecretIDs: []string{"token-1"},
+		PolicyIDs:      []string{"policy-1"},
+		Partitions:     []string{"default"},
+	})
+	payload := event.Payload.(closeSubscriptionPayload)
+
+	tests := map[string]struct {
+		sub  SubscriptionDescriptor
+		want bool
+	}{
+		"matches token":       {SubscriptionDescriptor{TokenSecretID: "token-1"}, true},
+		"matches policy":      {SubscriptionDescriptor{PolicyIDs: []string{"policy-1", "policy-2"}}, true},
+		"matches partition":   {SubscriptionDescriptor{Partition: "default"}, true},
+		"no match":            {SubscriptionDescriptor{TokenSecretID: "token-2", Partition: "other"}, false},
+		"empty request field": {SubscriptionDescriptor{RoleIDs: []string{"role-1"}}, false},
+	}
+
+	for name, tc := range tests {
+		t.Run(name, func(t *testing.T) {
+			if got := payload.matchesSubscription(tc.sub); got != tc.want {
+				t.Fatalf("matchesSubscription() = %v, want %v", got, tc.want)
+			}
+		})
+	}
+}
+
+func TestNewCloseSubscriptionEventByToken(t *testing.T) {
+	event := NewCloseSubscriptionEventByToken([]string{"token-1"})
+	payload := event.Payload.(closeSubscriptionPayload)
+
+	if !payload.matchesSubscription(SubscriptionDescriptor{TokenSecretID: "token-1"}) {
+		t.Fatal("expected the compatibility shim to close subscriptions by token")
+	}
+	if payload.matchesSubscription(SubscriptionDescriptor{Partition: "default"}) {
+		t.Fatal("expected the compatibility shim to set no other dimension")
+	}
+}
+
+func TestCloseSubscriptionPayload_NeverDeliveredToSubscribers(t *testing.T) {
+	event := NewCloseSubscriptionEvent(CloseSubscriptionRequest{Partitions: []string{"default"}})
+
+	if event.Payload.FilterByKey("any", "any") {
+		t.Fatal("close events must never pass FilterByKey")
+	}
+	if event.Payload.HasReadPermission(nil) {
+		t.Fatal("close events must never pass HasReadPermission")
+	}
+}
@@ -0,0 +1,139 @@
+package stream
+
+import (
+	"sync"
+	"testing"
+)
+
+type testTopic string
+
+func (t testTopic) String() string { return string(t) }
+
+func TestNewSubscription_MaterializesOncePerTopicAndKey(t *testing.T) {
+	cache := NewSnapshotCache(SnapshotCacheConfig{})
+
+	var calls int
+	snap := func(req SubscribeRequest) (*PayloadEvents, error) {
+		calls++
+		return NewPayloadEvents(Event{Topic: req.Topic, Payload: testFilterablePayload{
+			fields: map[string]interface{}{"Meta.env": "prod"},
+		}}), nil
+	}
+
+	req := SubscribeRequest{Topic: testTopic("nodes"), Key: "node-1"}
+
+	sub1, events1, err := NewSubscription(req, cache, snap)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	defer sub1.Close()
+
+	sub2, events2, err := NewSubscription(req, cache, snap)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	defer sub2.Close()
+
+	if calls != 1 {
+		t.Fatalf("expected snap to be called once for the same topic and key, got %d", calls)
+	}
+
+	// Filtering one subscription's copy must not affect the other's, even
+	// though both were materialized from the same cached snapshot.
+	events1.FilterByKey("node-1", "")
+	if got := events2.Len(); got != 1 {
+		t.Fatalf("expected the other subscription's events to be unaffected, got Len()=%d", got)
+	}
+}
+
+func TestNewSubscription_DistinctKeysMaterializeIndependently(t *testing.T) {
+	cache := NewSnapshotCache(SnapshotCacheConfig{})
+
+	var calls int
+	snap := func(req SubscribeRequest) (*PayloadEvents, error) {
+		calls++
+		return NewPayloadEvents(), nil
+	}
+
+	sub1, _, err := NewSubscription(SubscribeRequest{Topic: testTopic("nodes"), Key: "node-1"}, cache, snap)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	defer sub1.Close()
+
+	sub2, _, err := NewSubscription(SubscribeRequest{Topic: testTopic("nodes"), Key: "node-2"}, cache, snap)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	defer sub2.Close()
+
+	if calls != 2 {
+		t.Fatalf("expected snap to be called once per distinct key, got %d", calls)
+	}
+	if got := cache.Len(); got != 2 {
+		t.Fatalf("expected cache to hold one entry per key, got Len()=%d", got)
+	}
+}
+
+func TestNewSubscription_CloseAllowsEviction(t *testing.T) {
+	cache := NewSnapshotCache(SnapshotCacheConfig{MaxEntries: 1})
+	snap := func(req SubscribeRequest) (*PayloadEvents, error) { return NewPayloadEvents(), nil }
+
+	sub1, _, err := NewSubscription(SubscribeRequest{Topic: testTopic("nodes"), Key: "node-1"}, cache, snap)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	sub1.Close()
+
+	sub2, _, err := NewSubscription(SubscribeRequest{Topic: testTopic("nodes"), Key: "node-2"}, cache, snap)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	defer sub2.Close()
+
+	if got := cache.Len(); got != 1 {
+		t.Fatalf("expected MaxEntries to bound real subscriber memory, got Len()=%d", got)
+	}
+}
+
+func TestNewSubscription_ConcurrentMissesShareOneMaterialization(t *testing.T) {
+	cache := NewSnapshotCache(SnapshotCacheConfig{})
+
+	var calls int
+	var mu sync.Mutex
+	snap := func(req SubscribeRequest) (*PayloadEvents, error) {
+		mu.Lock()
+		calls++
+		mu.Unlock()
+		return NewPayloadEvents(), nil
+	}
+
+	req := SubscribeRequest{Topic: testTopic("nodes"), Key: "node-1"}
+
+	var wg sync.WaitGroup
+	subs := make([]*Subscription, 20)
+	for i := 0; i < 20; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			sub, _, err := NewSubscription(req, cache, snap)
+			if err != nil {
+				t.Errorf("unexpected error: %v", err)
+				return
+			}
+			subs[i] = sub
+		}(i)
+	}
+	wg.Wait()
+
+	mu.Lock()
+	gotCalls := calls
+	mu.Unlock()
+	if gotCalls != 1 {
+		t.Fatalf("expected concurrent misses on the same key to materialize exactly once, got %d calls", gotCalls)
+	}
+
+	for _, sub := range subs {
+		sub.Close()
+	}
+}